@@ -0,0 +1,19 @@
+package container
+
+// SourceSpec describes a single container image to pull: the primary
+// Source to resolve it from, optionally pinned to a Tag or Digest, plus an
+// ordered list of Mirrors to try in addition to Source.
+type SourceSpec struct {
+	Source string
+	Name   string
+	Tag    string
+	Digest string
+
+	// Mirrors are additional registry/repository endpoints tried, in
+	// order, before falling back to Source, the same way registries.conf
+	// mirrors are consulted ahead of the origin registry. See Resolve for
+	// the exact fallback semantics.
+	Mirrors []string
+
+	TLSVerify *bool
+}
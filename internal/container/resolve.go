@@ -0,0 +1,82 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Endpoint resolves a single fully-qualified container reference (e.g.
+// "registry.example.com/org/name:tag") to its canonical digest. It is
+// implemented by a registry client in production and faked in tests.
+type Endpoint interface {
+	Resolve(ref string) (digest string, err error)
+}
+
+// StatusError wraps the HTTP status code returned by a registry, so Resolve
+// can tell a definitive 404 apart from a transient transport error or 5xx.
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusError) Error() string { return e.Err.Error() }
+func (e *StatusError) Unwrap() error { return e.Err }
+
+// Endpoints returns the ordered list of fully-qualified references Resolve
+// tries for spec: each of spec.Mirrors first, in order, followed by
+// spec.Source, each combined with spec.Digest or spec.Tag if set.
+func (spec SourceSpec) Endpoints() []string {
+	ref := func(source string) string {
+		switch {
+		case spec.Digest != "":
+			return source + "@" + spec.Digest
+		case spec.Tag != "":
+			return source + ":" + spec.Tag
+		default:
+			return source
+		}
+	}
+
+	refs := make([]string, 0, len(spec.Mirrors)+1)
+	for _, mirror := range spec.Mirrors {
+		refs = append(refs, ref(mirror))
+	}
+	refs = append(refs, ref(spec.Source))
+
+	return refs
+}
+
+// Resolve resolves spec against endpoint, trying spec.Endpoints() in order.
+// A 404 from an endpoint is treated as definitive, the same way typical
+// container-tools mirror configuration treats it (the image is assumed
+// genuinely absent rather than misconfigured), so Resolve returns
+// immediately without trying any further endpoint. Any other status below
+// 500 is also returned immediately. Only a transport failure (an error
+// that is not a StatusError) or a 5xx status is treated as transient, in
+// which case Resolve falls through to the next endpoint.
+func Resolve(endpoint Endpoint, spec SourceSpec) (digest, resolvedRef string, err error) {
+	refs := spec.Endpoints()
+
+	var lastErr error
+	for _, ref := range refs {
+		digest, err := endpoint.Resolve(ref)
+		if err == nil {
+			return digest, ref, nil
+		}
+
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			if statusErr.StatusCode == http.StatusNotFound {
+				return "", "", fmt.Errorf("%s: not found (404 treated as definitive, not trying further mirrors): %w", ref, err)
+			}
+			if statusErr.StatusCode < http.StatusInternalServerError {
+				return "", "", fmt.Errorf("%s: status %d is not retried on further mirrors: %w", ref, statusErr.StatusCode, err)
+			}
+		}
+
+		lastErr = fmt.Errorf("%s: %w", ref, err)
+	}
+
+	return "", "", fmt.Errorf("failed to resolve %q against all %d endpoint(s), last error: %w", spec.Source, len(refs), lastErr)
+}
@@ -0,0 +1,89 @@
+package container
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// fakeEndpoint resolves refs according to a fixed script, and records which
+// refs it was asked to resolve, in order.
+type fakeEndpoint struct {
+	script map[string]error
+	tried  []string
+}
+
+func (f *fakeEndpoint) Resolve(ref string) (string, error) {
+	f.tried = append(f.tried, ref)
+	if err := f.script[ref]; err != nil {
+		return "", err
+	}
+	return "sha256:" + ref, nil
+}
+
+func TestResolveSucceedsOnFirstMirror(t *testing.T) {
+	spec := SourceSpec{
+		Source:  "origin.example.com/org/name",
+		Tag:     "latest",
+		Mirrors: []string{"mirror1.example.com/org/name", "mirror2.example.com/org/name"},
+	}
+	endpoint := &fakeEndpoint{script: map[string]error{}}
+
+	digest, ref, err := Resolve(endpoint, spec)
+	if err != nil {
+		t.Fatalf("Resolve() returned an error: %v", err)
+	}
+	if ref != "mirror1.example.com/org/name:latest" {
+		t.Fatalf("expected the first mirror to be used, got %q", ref)
+	}
+	if len(endpoint.tried) != 1 {
+		t.Fatalf("expected only the first mirror to be tried, got %v", endpoint.tried)
+	}
+	if digest == "" {
+		t.Fatal("expected a non-empty digest")
+	}
+}
+
+func TestResolveStopsOn404WithoutTryingFurtherMirrors(t *testing.T) {
+	spec := SourceSpec{
+		Source:  "origin.example.com/org/name",
+		Tag:     "latest",
+		Mirrors: []string{"mirror1.example.com/org/name", "mirror2.example.com/org/name"},
+	}
+	endpoint := &fakeEndpoint{script: map[string]error{
+		"mirror1.example.com/org/name:latest": &StatusError{StatusCode: http.StatusNotFound, Err: errors.New("manifest unknown")},
+	}}
+
+	if _, _, err := Resolve(endpoint, spec); err == nil {
+		t.Fatal("expected Resolve() to fail on a definitive 404")
+	}
+	if len(endpoint.tried) != 1 {
+		t.Fatalf("expected a 404 to stop further mirrors from being tried, got %v", endpoint.tried)
+	}
+}
+
+func TestResolveFallsThroughOn5xxAndTransportErrors(t *testing.T) {
+	spec := SourceSpec{
+		Source:  "origin.example.com/org/name",
+		Tag:     "latest",
+		Mirrors: []string{"mirror1.example.com/org/name", "mirror2.example.com/org/name"},
+	}
+	endpoint := &fakeEndpoint{script: map[string]error{
+		"mirror1.example.com/org/name:latest": &StatusError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("503")},
+		"mirror2.example.com/org/name:latest": errors.New("connection reset by peer"),
+	}}
+
+	digest, ref, err := Resolve(endpoint, spec)
+	if err != nil {
+		t.Fatalf("Resolve() returned an error: %v", err)
+	}
+	if ref != "origin.example.com/org/name:latest" {
+		t.Fatalf("expected fallback to Source after all mirrors failed transiently, got %q", ref)
+	}
+	if len(endpoint.tried) != 3 {
+		t.Fatalf("expected every endpoint to be tried in order, got %v", endpoint.tried)
+	}
+	if digest == "" {
+		t.Fatal("expected a non-empty digest")
+	}
+}
@@ -2,32 +2,246 @@ package reporegistry
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sync"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	"github.com/osbuild/osbuild-composer/internal/container"
 	"github.com/osbuild/osbuild-composer/internal/distro"
 	"github.com/osbuild/osbuild-composer/internal/rpmmd"
 )
 
+// DistroIDParser standardizes a distro ID string, such as one supplied by a
+// CLI user or an API request (e.g. "rhel-9.4", "rhel-94", "fedora-40"), into
+// the canonical distro name used as the key into the loaded repository
+// definitions. It is typically implemented by a distrofactory.Factory,
+// which already has to solve this problem to construct a distro.Distro.
+type DistroIDParser interface {
+	Standardize(idStr string) (string, error)
+}
+
+// overlayKey identifies the distro+arch bucket a set of overlay repos
+// (added via RepoRegistry.Overlay) applies to.
+type overlayKey struct {
+	distro string
+	arch   string
+}
+
 // RepoRegistry represents a database of distro and architecture
 // specific RPM repositories. Image types are considered only
 // if the loaded repository definition contains any ImageTypeTags.
+//
+// RepoRegistry is safe for concurrent use: mu guards repos and overlays so
+// that long-lived services can Reload or Overlay repositories while other
+// goroutines are reading them.
 type RepoRegistry struct {
+	mu sync.RWMutex
+
 	repos rpmmd.DistrosRepoConfigs
+
+	// parser resolves distro ID strings (e.g. "rhel-9.4") to the distro
+	// name used as a key into repos. It is nil unless the registry was
+	// constructed with NewWithParser and a non-nil parser; while it is nil,
+	// the ReposByDistroID and ReposByImageTypeID lookups return an error.
+	parser DistroIDParser
+
+	// repoConfigPaths are the paths repos was originally loaded from. It
+	// is empty for a registry built with NewFromDistrosRepoConfigs, which
+	// has no on-disk source to reload from.
+	repoConfigPaths []string
+
+	// overlays holds user-supplied repos layered on top of repos, added
+	// via Overlay and removed via RemoveOverlay.
+	overlays map[overlayKey][]rpmmd.RepoConfig
 }
 
 // New returns a new RepoRegistry instance with the data
-// loaded from the given repoConfigPaths
+// loaded from the given repoConfigPaths. It returns an error not only
+// when loading fails, but also when the given paths did not yield a
+// single repository, since callers otherwise tend to only check the
+// error and end up with a registry that silently answers every query
+// with "no repositories found" much later down the line.
 func New(repoConfigPaths []string) (*RepoRegistry, error) {
+	return NewWithParser(repoConfigPaths, nil)
+}
+
+// NewWithParser is like New, but also registers a DistroIDParser, enabling
+// the ReposByDistroID and ReposByImageTypeID lookups for callers that only
+// have a distro ID string (e.g. CLI tools and API handlers) rather than an
+// already-instantiated distro.Distro.
+func NewWithParser(repoConfigPaths []string, parser DistroIDParser) (*RepoRegistry, error) {
 	repositories, err := rpmmd.LoadAllRepositories(repoConfigPaths)
 	if err != nil {
 		return nil, err
 	}
 
-	return &RepoRegistry{repositories}, nil
+	if len(repositories) == 0 {
+		return nil, fmt.Errorf("no repositories found in any of the given paths: %v", repoConfigPaths)
+	}
+
+	return &RepoRegistry{
+		repos:           repositories,
+		parser:          parser,
+		repoConfigPaths: repoConfigPaths,
+		overlays:        make(map[overlayKey][]rpmmd.RepoConfig),
+	}, nil
+}
+
+// Reload re-reads the repoConfigPaths the registry was originally
+// constructed with, replacing repos. It leaves any overlays in place. This
+// lets long-lived services such as osbuild-composer or the weldr API pick
+// up new or changed repository definitions without a restart.
+func (r *RepoRegistry) Reload() error {
+	if len(r.repoConfigPaths) == 0 {
+		return fmt.Errorf("this RepoRegistry was not constructed from repoConfigPaths, it cannot be reloaded")
+	}
+
+	repositories, err := rpmmd.LoadAllRepositories(r.repoConfigPaths)
+	if err != nil {
+		return err
+	}
+
+	if len(repositories) == 0 {
+		return fmt.Errorf("no repositories found in any of the given paths: %v", r.repoConfigPaths)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.repos = repositories
+
+	return nil
+}
+
+// WatchForChanges starts a background goroutine that watches every path in
+// repoConfigPaths for filesystem changes and calls Reload whenever one
+// occurs, logging (rather than returning) any error encountered while
+// reloading, since there is no caller left to hand it to. The returned stop
+// function releases the watcher and must be called once it is no longer
+// needed.
+func (r *RepoRegistry) WatchForChanges() (stop func(), err error) {
+	if len(r.repoConfigPaths) == 0 {
+		return nil, fmt.Errorf("this RepoRegistry was not constructed from repoConfigPaths, there is nothing to watch")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a filesystem watcher: %v", err)
+	}
+
+	for _, path := range r.repoConfigPaths {
+		if err := watcher.Add(path); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("unable to watch %q for changes: %v", path, err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if err := r.Reload(); err != nil {
+					logrus.Errorf("reporegistry: failed to reload repositories after a filesystem change: %v", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Errorf("reporegistry: filesystem watcher error: %v", err)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		watcher.Close()
+	}, nil
+}
+
+// Overlay layers extras on top of the on-disk repos for the given distro and
+// architecture. Overlay repos are merged into the result of every read
+// method (ReposByArchName, reposByImageTypeName, DistroHasRepos, and
+// everything built on top of them) and honor ImageTypeTags the same way as
+// file-loaded repos. Use RemoveOverlay to remove them again.
+func (r *RepoRegistry) Overlay(distro, arch string, extras []rpmmd.RepoConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.overlays == nil {
+		r.overlays = make(map[overlayKey][]rpmmd.RepoConfig)
+	}
+	key := overlayKey{distro: distro, arch: arch}
+	r.overlays[key] = append(r.overlays[key], extras...)
+}
+
+// RemoveOverlay removes the overlay repo with the given Id, added previously
+// via Overlay, from every distro+arch bucket it was added to.
+func (r *RepoRegistry) RemoveOverlay(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, repos := range r.overlays {
+		filtered := repos[:0]
+		for _, repo := range repos {
+			if repo.Id != id {
+				filtered = append(filtered, repo)
+			}
+		}
+		r.overlays[key] = filtered
+	}
+}
+
+// NewTestedDefault returns a RepoRegistry loaded from the repository
+// definitions checked into this repository, for use in unit tests that
+// need a real, populated RepoRegistry. It resolves the repositories/
+// directory relative to the location of this source file, so it works
+// regardless of the working directory `go test` happens to be invoked
+// from.
+func NewTestedDefault() (*RepoRegistry, error) {
+	path, err := testedRepoConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return New([]string{path})
+}
+
+// testedRepoConfigPath walks up from the directory containing this source
+// file until it finds the repositories/ directory at the root of the
+// module.
+func testedRepoConfigPath() (string, error) {
+	_, thisFile, _, ok := runtime.Caller(0)
+	if !ok {
+		return "", fmt.Errorf("unable to determine the location of reporegistry.go")
+	}
+
+	dir := filepath.Dir(thisFile)
+	for {
+		candidate := filepath.Join(dir, "repositories")
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("could not find a repositories/ directory above %s", thisFile)
+		}
+		dir = parent
+	}
 }
 
 func NewFromDistrosRepoConfigs(distrosRepoConfigs rpmmd.DistrosRepoConfigs) *RepoRegistry {
-	return &RepoRegistry{distrosRepoConfigs}
+	return &RepoRegistry{repos: distrosRepoConfigs, overlays: make(map[overlayKey][]rpmmd.RepoConfig)}
 }
 
 // ReposByImageType returns a slice of rpmmd.RepoConfig instances, which should be used for building the specific
@@ -44,6 +258,134 @@ func (r *RepoRegistry) ReposByImageType(imageType distro.ImageType) ([]rpmmd.Rep
 	return r.reposByImageTypeName(imageType.Arch().Distro().Name(), imageType.Arch().Name(), imageType.Name())
 }
 
+// ReposByDistroID returns a slice of rpmmd.RepoConfig instances for the
+// given distro ID string and architecture, such as "rhel-9.4" or "rhel-94".
+// The distro ID is resolved to a distro name via the DistroIDParser the
+// registry was constructed with (see NewWithParser), which is what allows
+// callers that only have a user-supplied ID string, rather than an
+// already-instantiated distro.Distro, to look up repositories.
+func (r *RepoRegistry) ReposByDistroID(idStr, arch string, includeTagged bool) ([]rpmmd.RepoConfig, error) {
+	distroName, err := r.standardizeDistroID(idStr)
+	if err != nil {
+		return nil, err
+	}
+	return r.ReposByArchName(distroName, arch, includeTagged)
+}
+
+// ReposByImageTypeID is the distro-ID-string counterpart of ReposByImageType,
+// for callers that only have a distro ID string and an image type name
+// rather than an already-instantiated distro.ImageType.
+func (r *RepoRegistry) ReposByImageTypeID(idStr, arch, imageType string) ([]rpmmd.RepoConfig, error) {
+	distroName, err := r.standardizeDistroID(idStr)
+	if err != nil {
+		return nil, err
+	}
+	return r.reposByImageTypeName(distroName, arch, imageType)
+}
+
+// standardizeDistroID resolves a distro ID string to the distro name used
+// as a key into repos, using the registry's DistroIDParser.
+func (r *RepoRegistry) standardizeDistroID(idStr string) (string, error) {
+	if r.parser == nil {
+		return "", fmt.Errorf("this RepoRegistry was not constructed with a DistroIDParser, use NewWithParser to look up repositories by distro ID")
+	}
+	return r.parser.Standardize(idStr)
+}
+
+// ReposByPackageSet returns a slice of rpmmd.RepoConfig instances that
+// should be used when depsolving the given named package set (e.g. "build",
+// "os", "payload") of the given image type. It behaves like ReposByImageType,
+// except that repositories with PackageSetTags set are only included when
+// packageSetName matches one of their tags. Repositories without
+// PackageSetTags are included for every package set, exactly as in
+// ReposByImageType, which lets a build-only repo (e.g. one providing
+// rpm-ostree for the buildroot) be excluded from the target OS package set.
+func (r *RepoRegistry) ReposByPackageSet(imageType distro.ImageType, packageSetName string) ([]rpmmd.RepoConfig, error) {
+	if imageType.Arch() == nil || reflect.ValueOf(imageType.Arch()).IsNil() {
+		return nil, fmt.Errorf("there is no architecture associated with the provided image type")
+	}
+	if imageType.Arch().Distro() == nil || reflect.ValueOf(imageType.Arch().Distro()).IsNil() {
+		return nil, fmt.Errorf("there is no distribution associated with the architecture associated with the provided image type")
+	}
+	return r.reposByPackageSetName(imageType.Arch().Distro().Name(), imageType.Arch().Name(), imageType.Name(), packageSetName)
+}
+
+// reposByPackageSetName is the distro/arch/image-type-name counterpart of
+// ReposByPackageSet; see its documentation for behavior.
+func (r *RepoRegistry) reposByPackageSetName(distro, arch, imageType, packageSetName string) ([]rpmmd.RepoConfig, error) {
+	imageTypeRepos, err := r.reposByImageTypeName(distro, arch, imageType)
+	if err != nil {
+		return nil, err
+	}
+
+	repositories := []rpmmd.RepoConfig{}
+	for _, repo := range imageTypeRepos {
+		// Add all repositories without package_set_tags
+		if len(repo.PackageSetTags) == 0 {
+			repositories = append(repositories, repo)
+			continue
+		}
+
+		// Add all repositories tagged with the package set name
+		for _, packageSetTag := range repo.PackageSetTags {
+			if packageSetTag == packageSetName {
+				repositories = append(repositories, repo)
+				break
+			}
+		}
+	}
+
+	return repositories, nil
+}
+
+// ContainerSourcesByImageType returns the container.SourceSpec instances
+// that should be used to pull the container images embedded by the given
+// image type (e.g. bootc, ostree-container), resolved from the Containers
+// declared on the repositories associated with the image type's distro and
+// architecture, the same way ReposByImageType resolves RPM repos: entries
+// without ImageTypeTags always apply, entries tagged with the image type
+// name apply in addition.
+//
+// Each returned SourceSpec carries its declared Mirrors in order; pass it to
+// container.Resolve to actually pull it, which implements the mirror
+// fallback (try each mirror in order, treat a 404 as definitive, only fall
+// through to the next endpoint on a transport error or 5xx).
+func (r *RepoRegistry) ContainerSourcesByImageType(imageType distro.ImageType) ([]container.SourceSpec, error) {
+	if imageType.Arch() == nil || reflect.ValueOf(imageType.Arch()).IsNil() {
+		return nil, fmt.Errorf("there is no architecture associated with the provided image type")
+	}
+	if imageType.Arch().Distro() == nil || reflect.ValueOf(imageType.Arch().Distro()).IsNil() {
+		return nil, fmt.Errorf("there is no distribution associated with the architecture associated with the provided image type")
+	}
+	return r.containerSourcesByImageTypeName(imageType.Arch().Distro().Name(), imageType.Arch().Name(), imageType.Name())
+}
+
+// containerSourcesByImageTypeName is the distro/arch/image-type-name
+// counterpart of ContainerSourcesByImageType; see its documentation for
+// behavior.
+func (r *RepoRegistry) containerSourcesByImageTypeName(distro, arch, imageType string) ([]container.SourceSpec, error) {
+	repos, err := r.reposByImageTypeName(distro, arch, imageType)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []container.SourceSpec{}
+	for _, repo := range repos {
+		for _, c := range repo.Containers {
+			sources = append(sources, container.SourceSpec{
+				Source:    c.Registry + "/" + c.Repository,
+				Name:      c.Repository,
+				Tag:       c.Tag,
+				Digest:    c.Digest,
+				Mirrors:   c.Mirrors,
+				TLSVerify: c.TLSVerify,
+			})
+		}
+	}
+
+	return sources, nil
+}
+
 // reposByImageTypeName returns a slice of rpmmd.RepoConfig instances, which should be used for building the specific
 // image type name (of a given distribution and architecture). The method does not verify
 // if the given image type name is actually part of the architecture definition of the provided name.
@@ -113,13 +455,28 @@ func (r *RepoRegistry) ReposByArchName(distro, arch string, includeTagged bool)
 	return repositories, nil
 }
 
-// DistroHasRepos returns the repositories for the distro+arch, and a found flag
+// DistroHasRepos returns the repositories for the distro+arch, merged with
+// any overlay repos added via Overlay, and a found flag. This is the single
+// point where repos and overlays are read, so every other read method
+// (ReposByArchName, reposByImageTypeName, and everything built on top of
+// them) observes the lock and the overlay merge by going through it.
 func (r *RepoRegistry) DistroHasRepos(distro, arch string) (repos []rpmmd.RepoConfig, found bool) {
-	distroRepos, found := r.repos[distro]
-	if !found {
-		return repos, false
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	distroRepos, distroFound := r.repos[distro]
+	if distroFound {
+		repos, found = distroRepos[arch]
 	}
-	repos, found = distroRepos[arch]
 
-	return repos, found
+	overlayRepos := r.overlays[overlayKey{distro: distro, arch: arch}]
+	if len(overlayRepos) == 0 {
+		return repos, found
+	}
+
+	merged := make([]rpmmd.RepoConfig, 0, len(repos)+len(overlayRepos))
+	merged = append(merged, repos...)
+	merged = append(merged, overlayRepos...)
+
+	return merged, true
 }
@@ -0,0 +1,227 @@
+package reporegistry
+
+import (
+	"testing"
+
+	"github.com/osbuild/osbuild-composer/internal/rpmmd"
+)
+
+func TestNewTestedDefault(t *testing.T) {
+	reg, err := NewTestedDefault()
+	if err != nil {
+		t.Fatalf("NewTestedDefault() returned an error: %v", err)
+	}
+
+	if len(reg.repos) == 0 {
+		t.Fatal("expected NewTestedDefault() to load at least one distro, got none")
+	}
+}
+
+// identityParser standardizes a distro ID to itself, except for the
+// aliases it's told to fold into a canonical name.
+type identityParser struct {
+	aliases map[string]string
+}
+
+func (p identityParser) Standardize(idStr string) (string, error) {
+	if canonical, ok := p.aliases[idStr]; ok {
+		return canonical, nil
+	}
+	return idStr, nil
+}
+
+func TestReposByDistroIDWithoutParser(t *testing.T) {
+	reg, err := NewTestedDefault()
+	if err != nil {
+		t.Fatalf("NewTestedDefault() returned an error: %v", err)
+	}
+
+	if _, err := reg.ReposByDistroID("rhel-9.4", "x86_64", true); err == nil {
+		t.Fatal("expected ReposByDistroID() to fail on a registry without a DistroIDParser")
+	}
+}
+
+func TestReposByDistroIDResolvesAliases(t *testing.T) {
+	path, err := testedRepoConfigPath()
+	if err != nil {
+		t.Fatalf("testedRepoConfigPath() returned an error: %v", err)
+	}
+
+	parser := identityParser{aliases: map[string]string{
+		"rhel-94":   "rhel-9.4",
+		"rhel-9.40": "rhel-9.4",
+	}}
+
+	reg, err := NewWithParser([]string{path}, parser)
+	if err != nil {
+		t.Fatalf("NewWithParser() returned an error: %v", err)
+	}
+
+	canonical, err := reg.ReposByDistroID("rhel-9.4", "x86_64", true)
+	if err != nil {
+		t.Skipf("rhel-9.4/x86_64 not present in test repo configs: %v", err)
+	}
+
+	for _, alias := range []string{"rhel-94", "rhel-9.40"} {
+		repos, err := reg.ReposByDistroID(alias, "x86_64", true)
+		if err != nil {
+			t.Fatalf("ReposByDistroID(%q) returned an error: %v", alias, err)
+		}
+		if len(repos) != len(canonical) {
+			t.Fatalf("ReposByDistroID(%q) returned %d repos, expected %d", alias, len(repos), len(canonical))
+		}
+	}
+}
+
+func TestReposByPackageSetNameDisjointSubsets(t *testing.T) {
+	repoConfigs := rpmmd.DistrosRepoConfigs{
+		"test-distro": {
+			"x86_64": []rpmmd.RepoConfig{
+				{Name: "common", BaseURL: "http://example.com/common"},
+				{
+					Name:           "build-only",
+					BaseURL:        "http://example.com/build",
+					ImageTypeTags:  []string{"qcow2"},
+					PackageSetTags: []string{"build"},
+				},
+				{
+					Name:           "os-only",
+					BaseURL:        "http://example.com/os",
+					ImageTypeTags:  []string{"qcow2"},
+					PackageSetTags: []string{"os"},
+				},
+			},
+		},
+	}
+
+	reg := NewFromDistrosRepoConfigs(repoConfigs)
+
+	buildRepos, err := reg.reposByPackageSetName("test-distro", "x86_64", "qcow2", "build")
+	if err != nil {
+		t.Fatalf("reposByPackageSetName(build) returned an error: %v", err)
+	}
+	osRepos, err := reg.reposByPackageSetName("test-distro", "x86_64", "qcow2", "os")
+	if err != nil {
+		t.Fatalf("reposByPackageSetName(os) returned an error: %v", err)
+	}
+
+	assertHasRepo := func(t *testing.T, repos []rpmmd.RepoConfig, name string, want bool) {
+		t.Helper()
+		found := false
+		for _, repo := range repos {
+			if repo.Name == name {
+				found = true
+				break
+			}
+		}
+		if found != want {
+			t.Fatalf("repo %q presence = %v, want %v", name, found, want)
+		}
+	}
+
+	assertHasRepo(t, buildRepos, "common", true)
+	assertHasRepo(t, buildRepos, "build-only", true)
+	assertHasRepo(t, buildRepos, "os-only", false)
+
+	assertHasRepo(t, osRepos, "common", true)
+	assertHasRepo(t, osRepos, "os-only", true)
+	assertHasRepo(t, osRepos, "build-only", false)
+}
+
+func TestOverlayAndRemoveOverlay(t *testing.T) {
+	repoConfigs := rpmmd.DistrosRepoConfigs{
+		"test-distro": {
+			"x86_64": []rpmmd.RepoConfig{
+				{Id: "base", Name: "base", BaseURL: "http://example.com/base"},
+			},
+		},
+	}
+	reg := NewFromDistrosRepoConfigs(repoConfigs)
+
+	repos, found := reg.DistroHasRepos("test-distro", "x86_64")
+	if !found || len(repos) != 1 {
+		t.Fatalf("expected exactly the base repo before overlaying, got %+v (found=%v)", repos, found)
+	}
+
+	reg.Overlay("test-distro", "x86_64", []rpmmd.RepoConfig{
+		{Id: "extra", Name: "extra", BaseURL: "http://example.com/extra"},
+	})
+
+	repos, found = reg.DistroHasRepos("test-distro", "x86_64")
+	if !found || len(repos) != 2 {
+		t.Fatalf("expected the base repo plus the overlay after Overlay(), got %+v (found=%v)", repos, found)
+	}
+
+	// Overlaying a distro+arch with no on-disk repos should still work.
+	reg.Overlay("test-distro", "aarch64", []rpmmd.RepoConfig{
+		{Id: "aarch64-extra", Name: "aarch64-extra", BaseURL: "http://example.com/aarch64-extra"},
+	})
+	if repos, found := reg.DistroHasRepos("test-distro", "aarch64"); !found || len(repos) != 1 {
+		t.Fatalf("expected the overlay-only repo for aarch64, got %+v (found=%v)", repos, found)
+	}
+
+	reg.RemoveOverlay("extra")
+	repos, found = reg.DistroHasRepos("test-distro", "x86_64")
+	if !found || len(repos) != 1 || repos[0].Id != "base" {
+		t.Fatalf("expected only the base repo after RemoveOverlay(), got %+v (found=%v)", repos, found)
+	}
+}
+
+func TestReloadWithoutRepoConfigPaths(t *testing.T) {
+	reg := NewFromDistrosRepoConfigs(rpmmd.DistrosRepoConfigs{})
+	if err := reg.Reload(); err == nil {
+		t.Fatal("expected Reload() to fail on a registry not constructed from repoConfigPaths")
+	}
+}
+
+func TestContainerSourcesByImageTypeName(t *testing.T) {
+	tlsVerify := true
+	repoConfigs := rpmmd.DistrosRepoConfigs{
+		"test-distro": {
+			"x86_64": []rpmmd.RepoConfig{
+				{
+					Name: "bootc-containers",
+					Containers: []rpmmd.ContainerSource{
+						{
+							Registry:   "registry.example.com",
+							Repository: "org/bootc-base",
+							Tag:        "latest",
+							Mirrors:    []string{"mirror1.example.com/org/bootc-base", "mirror2.example.com/org/bootc-base"},
+							TLSVerify:  &tlsVerify,
+						},
+					},
+					ImageTypeTags: []string{"bootc"},
+				},
+				{
+					Name: "unrelated",
+					Containers: []rpmmd.ContainerSource{
+						{Registry: "registry.example.com", Repository: "org/other"},
+					},
+					ImageTypeTags: []string{"qcow2"},
+				},
+			},
+		},
+	}
+
+	reg := NewFromDistrosRepoConfigs(repoConfigs)
+
+	sources, err := reg.containerSourcesByImageTypeName("test-distro", "x86_64", "bootc")
+	if err != nil {
+		t.Fatalf("containerSourcesByImageTypeName() returned an error: %v", err)
+	}
+
+	if len(sources) != 1 {
+		t.Fatalf("expected exactly one container source for the bootc image type, got %d: %+v", len(sources), sources)
+	}
+
+	got := sources[0]
+	if got.Source != "registry.example.com/org/bootc-base" {
+		t.Errorf("Source = %q, want %q", got.Source, "registry.example.com/org/bootc-base")
+	}
+	if len(got.Mirrors) != 2 {
+		t.Errorf("expected 2 mirrors to be carried through in order, got %+v", got.Mirrors)
+	}
+	if got.TLSVerify == nil || !*got.TLSVerify {
+		t.Errorf("expected TLSVerify to be carried through as true")
+	}
+}
@@ -0,0 +1,105 @@
+package rpmmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RepoConfig represents a single RPM repository, as defined in a repository
+// definition file under a repoConfigPath (e.g. repositories/<distro>.json).
+type RepoConfig struct {
+	Id             string `json:"id,omitempty"`
+	Name           string `json:"name,omitempty"`
+	BaseURL        string `json:"baseurl,omitempty"`
+	Metalink       string `json:"metalink,omitempty"`
+	MirrorList     string `json:"mirrorlist,omitempty"`
+	GPGKey         string `json:"gpgkey,omitempty"`
+	CheckGPG       bool   `json:"check_gpg,omitempty"`
+	IgnoreSSL      bool   `json:"ignore_ssl,omitempty"`
+	MetadataExpire string `json:"metadata_expire,omitempty"`
+	RHSM           bool   `json:"rhsm,omitempty"`
+
+	// ImageTypeTags restricts a repository to the named image types. A
+	// repository with no ImageTypeTags is included for every image type.
+	ImageTypeTags []string `json:"image_type_tags,omitempty"`
+
+	// PackageSetTags restricts a repository to the named package sets
+	// (e.g. "build", "os", "payload") of the image types it already
+	// applies to via ImageTypeTags. A repository with no PackageSetTags
+	// is included in every package set, exactly like one with no
+	// ImageTypeTags is included for every image type.
+	PackageSetTags []string `json:"package_set_tags,omitempty"`
+
+	// Containers lists the container images that image types which embed
+	// containers (e.g. bootc, ostree-container) should pull from this
+	// repository's registry. ImageTypeTags still governs which image
+	// types a Containers entry applies to.
+	Containers []ContainerSource `json:"container_sources,omitempty"`
+}
+
+// ContainerSource describes a single container image to pull: the registry
+// and repository to pull it from, optionally pinned to a Tag or Digest, an
+// optional ordered list of Mirrors to try first, and whether to verify the
+// registry's TLS certificate.
+type ContainerSource struct {
+	Registry   string   `json:"registry"`
+	Repository string   `json:"repository"`
+	Tag        string   `json:"tag,omitempty"`
+	Digest     string   `json:"digest,omitempty"`
+	Mirrors    []string `json:"mirrors,omitempty"`
+	TLSVerify  *bool    `json:"tls_verify,omitempty"`
+}
+
+// DistrosRepoConfigs holds repository definitions for every known distro
+// and architecture: distro name -> architecture name -> repositories.
+type DistrosRepoConfigs map[string]map[string][]RepoConfig
+
+// LoadAllRepositories loads the repository definitions found in each of the
+// given repoConfigPaths. Every path is expected to contain one JSON file per
+// distro (e.g. rhel-9.4.json), each holding a mapping of architecture name
+// to the list of RepoConfig valid for it. A path that does not exist is
+// skipped rather than treated as an error, since callers commonly pass a
+// list of candidate locations.
+func LoadAllRepositories(repoConfigPaths []string) (DistrosRepoConfigs, error) {
+	distrosRepoConfigs := make(DistrosRepoConfigs)
+
+	for _, path := range repoConfigPaths {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("error reading repository definitions from %q: %v", path, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+				continue
+			}
+
+			distroName := strings.TrimSuffix(entry.Name(), ".json")
+
+			data, err := os.ReadFile(filepath.Join(path, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("error reading %q: %v", entry.Name(), err)
+			}
+
+			var archRepos map[string][]RepoConfig
+			if err := json.Unmarshal(data, &archRepos); err != nil {
+				return nil, fmt.Errorf("error parsing %q: %v", entry.Name(), err)
+			}
+
+			if _, exists := distrosRepoConfigs[distroName]; !exists {
+				distrosRepoConfigs[distroName] = make(map[string][]RepoConfig)
+			}
+			for arch, repos := range archRepos {
+				distrosRepoConfigs[distroName][arch] = append(distrosRepoConfigs[distroName][arch], repos...)
+			}
+		}
+	}
+
+	return distrosRepoConfigs, nil
+}